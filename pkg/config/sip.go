@@ -0,0 +1,61 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+// SIPConfig holds the options the SIP service reads off its static config.
+// Its fields are the ones the DEFCON graceful-degradation modes depend on.
+type SIPConfig struct {
+	// DefconOutboundRateLimitInterval is the minimum spacing between
+	// successive outbound calls a single caller may place once DEFCON 4
+	// (rate-limited) is in effect. Zero disables the interval, which
+	// effectively disables the limiter (every call is allowed instantly).
+	DefconOutboundRateLimitInterval time.Duration
+	// DefconOutboundRateLimitBurst is the number of calls a caller may place
+	// in a single burst before DefconOutboundRateLimitInterval is enforced.
+	DefconOutboundRateLimitBurst int
+
+	// DefconAllowedDestinationPrefixes restricts CreateSIPParticipant's
+	// SipCallTo at DEFCON 3 (restricted) and below to numbers starting with
+	// one of these prefixes. An empty list allows every destination, i.e.
+	// the restriction is opt-in per deployment.
+	DefconAllowedDestinationPrefixes []string
+
+	// RequireMFAForOutboundTrunks gates the DEFCON 3 MFA-bound-token check
+	// for CreateSIPOutboundTrunk/UpdateSIPOutboundTrunk. It defaults to
+	// false (no enforcement) because the auth middleware that records an
+	// MFA binding on the request context hasn't shipped yet; flip it on
+	// once that middleware is deployed.
+	RequireMFAForOutboundTrunks bool
+}
+
+// IsDefconAllowedDestination reports whether dest is allowed to be called
+// under the DEFCON 3 destination allowlist. With no prefixes configured,
+// every destination is allowed.
+func (c *SIPConfig) IsDefconAllowedDestination(dest string) bool {
+	if len(c.DefconAllowedDestinationPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range c.DefconAllowedDestinationPrefixes {
+		if strings.HasPrefix(dest, prefix) {
+			return true
+		}
+	}
+	return false
+}
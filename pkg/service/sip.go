@@ -39,6 +39,9 @@ type SIPService struct {
 	psrpcClient rpc.SIPClient
 	store       SIPStore
 	roomService livekit.RoomService
+	telemetry   telemetry.TelemetryService
+
+	defconLimiters sipDefconLimiters
 }
 
 func NewSIPService(
@@ -57,13 +60,11 @@ func NewSIPService(
 		psrpcClient: psrpcClient,
 		store:       store,
 		roomService: rs,
+		telemetry:   ts,
 	}
 }
 
 func (s *SIPService) CreateSIPTrunk(ctx context.Context, req *livekit.CreateSIPTrunkRequest) (*livekit.SIPTrunkInfo, error) {
-	if err := EnsureSIPAdminPermission(ctx); err != nil {
-		return nil, twirpAuthError(err)
-	}
 	if s.store == nil {
 		return nil, ErrSIPNotConnected
 	}
@@ -85,28 +86,23 @@ func (s *SIPService) CreateSIPTrunk(ctx context.Context, req *livekit.CreateSIPT
 		Metadata:         req.Metadata,
 	}
 
-	// Validate all trunks including the new one first.
-	list, err := s.store.ListSIPInboundTrunk(ctx)
-	if err != nil {
-		return nil, err
-	}
-	list = append(list, info.AsInbound())
-	if err = sip.ValidateTrunks(list); err != nil {
+	// Pass the built inbound view, not req, so checkDefcon's wildcard
+	// InboundNumbers check (the same one CreateSIPInboundTrunk enforces)
+	// also applies through this legacy endpoint.
+	if err := s.ensureSIPAdminPermission(ctx, sipOpMutateInboundTrunk, info.AsInbound()); err != nil {
 		return nil, err
 	}
 
-	// Now we can generate ID and store.
-	info.SipTrunkId = guid.New(utils.SIPTrunkPrefix)
-	if err := s.store.StoreSIPTrunk(ctx, info); err != nil {
+	// List, validate and store atomically, so concurrent creates can't both
+	// pass validation against a set that's gone stale by the time either of
+	// them writes.
+	if err := s.store.ValidateAndStoreSIPTrunk(ctx, info); err != nil {
 		return nil, err
 	}
 	return info, nil
 }
 
 func (s *SIPService) CreateSIPInboundTrunk(ctx context.Context, req *livekit.CreateSIPInboundTrunkRequest) (*livekit.SIPInboundTrunkInfo, error) {
-	if err := EnsureSIPAdminPermission(ctx); err != nil {
-		return nil, twirpAuthError(err)
-	}
 	if s.store == nil {
 		return nil, ErrSIPNotConnected
 	}
@@ -116,31 +112,20 @@ func (s *SIPService) CreateSIPInboundTrunk(ctx context.Context, req *livekit.Cre
 	} else if info.SipTrunkId != "" {
 		return nil, errors.New("trunk ID must be empty")
 	}
-
-	// Keep ID empty still, so that validation can print "<new>" instead of a non-existent ID in the error.
-
-	// Validate all trunks including the new one first.
-	list, err := s.store.ListSIPInboundTrunk(ctx)
-	if err != nil {
-		return nil, err
-	}
-	list = append(list, info)
-	if err = sip.ValidateTrunks(list); err != nil {
+	if err := s.ensureSIPAdminPermission(ctx, sipOpMutateInboundTrunk, info); err != nil {
 		return nil, err
 	}
 
-	// Now we can generate ID and store.
-	info.SipTrunkId = guid.New(utils.SIPTrunkPrefix)
-	if err := s.store.StoreSIPInboundTrunk(ctx, info); err != nil {
+	// Keep ID empty still, so that validation can print "<new>" instead of a non-existent ID in the error.
+	// List, validate and store atomically, so two trunks can't both claim the
+	// same InboundNumbers/InboundAddresses by racing the validation window.
+	if err := s.store.ValidateAndStoreSIPInboundTrunk(ctx, info); err != nil {
 		return nil, err
 	}
 	return info, nil
 }
 
 func (s *SIPService) CreateSIPOutboundTrunk(ctx context.Context, req *livekit.CreateSIPOutboundTrunkRequest) (*livekit.SIPOutboundTrunkInfo, error) {
-	if err := EnsureSIPAdminPermission(ctx); err != nil {
-		return nil, twirpAuthError(err)
-	}
 	if s.store == nil {
 		return nil, ErrSIPNotConnected
 	}
@@ -150,9 +135,16 @@ func (s *SIPService) CreateSIPOutboundTrunk(ctx context.Context, req *livekit.Cr
 	} else if info.SipTrunkId != "" {
 		return nil, errors.New("trunk ID must be empty")
 	}
+	if err := s.ensureSIPAdminPermission(ctx, sipOpMutateOutboundTrunk, info); err != nil {
+		return nil, err
+	}
 
 	// No additional validation needed for outbound.
 	info.SipTrunkId = guid.New(utils.SIPTrunkPrefix)
+	// Assign an initial etag so the first UpdateSIPOutboundTrunk call after
+	// creation can still race-check against it, instead of silently skipping
+	// the etag check because it was left empty.
+	info.Etag = guid.New(sipEtagPrefix)
 	if err := s.store.StoreSIPOutboundTrunk(ctx, info); err != nil {
 		return nil, err
 	}
@@ -160,8 +152,8 @@ func (s *SIPService) CreateSIPOutboundTrunk(ctx context.Context, req *livekit.Cr
 }
 
 func (s *SIPService) GetSIPInboundTrunk(ctx context.Context, req *livekit.GetSIPInboundTrunkRequest) (*livekit.GetSIPInboundTrunkResponse, error) {
-	if err := EnsureSIPAdminPermission(ctx); err != nil {
-		return nil, twirpAuthError(err)
+	if err := s.ensureSIPAdminPermission(ctx, sipOpRead, nil); err != nil {
+		return nil, err
 	}
 	if s.store == nil {
 		return nil, ErrSIPNotConnected
@@ -176,8 +168,8 @@ func (s *SIPService) GetSIPInboundTrunk(ctx context.Context, req *livekit.GetSIP
 }
 
 func (s *SIPService) GetSIPOutboundTrunk(ctx context.Context, req *livekit.GetSIPOutboundTrunkRequest) (*livekit.GetSIPOutboundTrunkResponse, error) {
-	if err := EnsureSIPAdminPermission(ctx); err != nil {
-		return nil, twirpAuthError(err)
+	if err := s.ensureSIPAdminPermission(ctx, sipOpRead, nil); err != nil {
+		return nil, err
 	}
 	if s.store == nil {
 		return nil, ErrSIPNotConnected
@@ -192,8 +184,8 @@ func (s *SIPService) GetSIPOutboundTrunk(ctx context.Context, req *livekit.GetSI
 }
 
 func (s *SIPService) ListSIPTrunk(ctx context.Context, req *livekit.ListSIPTrunkRequest) (*livekit.ListSIPTrunkResponse, error) {
-	if err := EnsureSIPAdminPermission(ctx); err != nil {
-		return nil, twirpAuthError(err)
+	if err := s.ensureSIPAdminPermission(ctx, sipOpRead, nil); err != nil {
+		return nil, err
 	}
 	if s.store == nil {
 		return nil, ErrSIPNotConnected
@@ -208,8 +200,8 @@ func (s *SIPService) ListSIPTrunk(ctx context.Context, req *livekit.ListSIPTrunk
 }
 
 func (s *SIPService) ListSIPInboundTrunk(ctx context.Context, req *livekit.ListSIPInboundTrunkRequest) (*livekit.ListSIPInboundTrunkResponse, error) {
-	if err := EnsureSIPAdminPermission(ctx); err != nil {
-		return nil, twirpAuthError(err)
+	if err := s.ensureSIPAdminPermission(ctx, sipOpRead, nil); err != nil {
+		return nil, err
 	}
 	if s.store == nil {
 		return nil, ErrSIPNotConnected
@@ -224,8 +216,8 @@ func (s *SIPService) ListSIPInboundTrunk(ctx context.Context, req *livekit.ListS
 }
 
 func (s *SIPService) ListSIPOutboundTrunk(ctx context.Context, req *livekit.ListSIPOutboundTrunkRequest) (*livekit.ListSIPOutboundTrunkResponse, error) {
-	if err := EnsureSIPAdminPermission(ctx); err != nil {
-		return nil, twirpAuthError(err)
+	if err := s.ensureSIPAdminPermission(ctx, sipOpRead, nil); err != nil {
+		return nil, err
 	}
 	if s.store == nil {
 		return nil, ErrSIPNotConnected
@@ -240,8 +232,8 @@ func (s *SIPService) ListSIPOutboundTrunk(ctx context.Context, req *livekit.List
 }
 
 func (s *SIPService) DeleteSIPTrunk(ctx context.Context, req *livekit.DeleteSIPTrunkRequest) (*livekit.SIPTrunkInfo, error) {
-	if err := EnsureSIPAdminPermission(ctx); err != nil {
-		return nil, twirpAuthError(err)
+	if err := s.ensureSIPAdminPermission(ctx, sipOpMutateInboundTrunk, nil); err != nil {
+		return nil, err
 	}
 	if s.store == nil {
 		return nil, ErrSIPNotConnected
@@ -255,8 +247,8 @@ func (s *SIPService) DeleteSIPTrunk(ctx context.Context, req *livekit.DeleteSIPT
 }
 
 func (s *SIPService) CreateSIPDispatchRule(ctx context.Context, req *livekit.CreateSIPDispatchRuleRequest) (*livekit.SIPDispatchRuleInfo, error) {
-	if err := EnsureSIPAdminPermission(ctx); err != nil {
-		return nil, twirpAuthError(err)
+	if err := s.ensureSIPAdminPermission(ctx, sipOpMutateDispatchRule, nil); err != nil {
+		return nil, err
 	}
 	if s.store == nil {
 		return nil, ErrSIPNotConnected
@@ -273,27 +265,17 @@ func (s *SIPService) CreateSIPDispatchRule(ctx context.Context, req *livekit.Cre
 		Attributes:      req.Attributes,
 	}
 
-	// Validate all rules including the new one first.
-	list, err := s.store.ListSIPDispatchRule(ctx)
-	if err != nil {
-		return nil, err
-	}
-	list = append(list, info)
-	if err = sip.ValidateDispatchRules(list); err != nil {
-		return nil, err
-	}
-
-	// Now we can generate ID and store.
-	info.SipDispatchRuleId = guid.New(utils.SIPDispatchRulePrefix)
-	if err := s.store.StoreSIPDispatchRule(ctx, info); err != nil {
+	// List, validate and store atomically, so concurrent creates can't both
+	// pass validation against a dispatch rule set that's gone stale.
+	if err := s.store.ValidateAndStoreSIPDispatchRule(ctx, info); err != nil {
 		return nil, err
 	}
 	return info, nil
 }
 
 func (s *SIPService) ListSIPDispatchRule(ctx context.Context, req *livekit.ListSIPDispatchRuleRequest) (*livekit.ListSIPDispatchRuleResponse, error) {
-	if err := EnsureSIPAdminPermission(ctx); err != nil {
-		return nil, twirpAuthError(err)
+	if err := s.ensureSIPAdminPermission(ctx, sipOpRead, nil); err != nil {
+		return nil, err
 	}
 	if s.store == nil {
 		return nil, ErrSIPNotConnected
@@ -308,8 +290,8 @@ func (s *SIPService) ListSIPDispatchRule(ctx context.Context, req *livekit.ListS
 }
 
 func (s *SIPService) DeleteSIPDispatchRule(ctx context.Context, req *livekit.DeleteSIPDispatchRuleRequest) (*livekit.SIPDispatchRuleInfo, error) {
-	if err := EnsureSIPAdminPermission(ctx); err != nil {
-		return nil, twirpAuthError(err)
+	if err := s.ensureSIPAdminPermission(ctx, sipOpMutateDispatchRule, nil); err != nil {
+		return nil, err
 	}
 	if s.store == nil {
 		return nil, ErrSIPNotConnected
@@ -365,8 +347,8 @@ func (s *SIPService) CreateSIPParticipant(ctx context.Context, req *livekit.Crea
 }
 
 func (s *SIPService) CreateSIPParticipantRequest(ctx context.Context, req *livekit.CreateSIPParticipantRequest, projectID, host, wsUrl, token string) (*rpc.InternalCreateSIPParticipantRequest, error) {
-	if err := EnsureSIPCallPermission(ctx); err != nil {
-		return nil, twirpAuthError(err)
+	if err := s.ensureSIPCallPermission(ctx, req); err != nil {
+		return nil, err
 	}
 	if s.store == nil {
 		return nil, ErrSIPNotConnected
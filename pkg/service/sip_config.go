@@ -0,0 +1,195 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+// This file depends on livekit.SIPConfigBundle, livekit.ImportSIPConfigRequest
+// (and response/mode types), and livekit.SIPConfigConflict, none of which
+// exist in the pinned github.com/livekit/protocol version yet - they need to
+// land there first, with this repo's go.mod bumped to the resulting version,
+// before this file builds.
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/sip"
+)
+
+// ExportSIPConfig and ImportSIPConfig back the `livekit-cli sip config
+// export/import` surface; the CLI side lives in the livekit-cli repo and
+// isn't part of this change.
+func (s *SIPService) ExportSIPConfig(ctx context.Context, req *livekit.ExportSIPConfigRequest) (*livekit.SIPConfigBundle, error) {
+	if err := s.ensureSIPAdminPermission(ctx, sipOpRead, nil); err != nil {
+		return nil, err
+	}
+	if s.store == nil {
+		return nil, ErrSIPNotConnected
+	}
+	inbound, err := s.store.ListSIPInboundTrunk(ctx)
+	if err != nil {
+		return nil, err
+	}
+	outbound, err := s.store.ListSIPOutboundTrunk(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := s.store.ListSIPDispatchRule(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &livekit.SIPConfigBundle{
+		InboundTrunks:  inbound,
+		OutboundTrunks: outbound,
+		DispatchRules:  rules,
+	}, nil
+}
+
+func (s *SIPService) ImportSIPConfig(ctx context.Context, req *livekit.ImportSIPConfigRequest) (*livekit.ImportSIPConfigResponse, error) {
+	if err := s.ensureSIPAdminPermission(ctx, sipOpMutateInboundTrunk, nil); err != nil {
+		return nil, err
+	}
+	if s.store == nil {
+		return nil, ErrSIPNotConnected
+	}
+	bundle := req.Bundle
+	if bundle == nil {
+		return nil, fmt.Errorf("bundle is required")
+	}
+	// The admin-permission check above passed req=nil, so it never ran the
+	// per-trunk defcon checks (e.g. the DEFCON 4 wildcard-InboundNumbers
+	// rejection) that CreateSIPInboundTrunk/UpdateSIPInboundTrunk enforce,
+	// nor the outbound-trunk checks (e.g. the DEFCON 3 MFA requirement) of
+	// CreateSIPOutboundTrunk/UpdateSIPOutboundTrunk.
+	// Run them here so a bundle can't bypass defcon just by going through
+	// import instead of the single-trunk RPCs.
+	for _, t := range bundle.InboundTrunks {
+		if err := s.checkDefcon(ctx, sipOpMutateInboundTrunk, t); err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range bundle.OutboundTrunks {
+		if err := s.checkDefcon(ctx, sipOpMutateOutboundTrunk, t); err != nil {
+			return nil, err
+		}
+	}
+
+	switch req.Mode {
+	case livekit.SIPConfigImportMode_DRY_RUN:
+		conflicts, err := dryRunImportSIPConfig(ctx, s.store, bundle)
+		if err != nil {
+			return nil, err
+		}
+		return &livekit.ImportSIPConfigResponse{Conflicts: conflicts}, nil
+	case livekit.SIPConfigImportMode_REPLACE:
+		if err := s.store.ReplaceSIPConfig(ctx, bundle); err != nil {
+			return nil, err
+		}
+	case livekit.SIPConfigImportMode_MERGE:
+		if err := s.store.MergeSIPConfig(ctx, bundle); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown import mode %v", req.Mode)
+	}
+	return &livekit.ImportSIPConfigResponse{}, nil
+}
+
+// dryRunImportSIPConfig validates bundle against the existing config without
+// storing anything, and reports which entries in the bundle would conflict.
+// It mirrors MergeSIPConfig's actual semantics: bundle entries are upserted
+// by ID into the existing set (not merely appended - re-importing an
+// existing trunk with edits must not read as a brand new duplicate), and
+// each collection is validated as one all-or-nothing unit, same as
+// MergeSIPConfig/ReplaceSIPConfig do. A failing collection reports every
+// bundle entry in that collection as conflicting, since the underlying
+// sip.Validate* error doesn't attribute blame to a single entry and the real
+// apply would reject the whole collection, not just one entry in it.
+func dryRunImportSIPConfig(ctx context.Context, store SIPStore, bundle *livekit.SIPConfigBundle) ([]*livekit.SIPConfigConflict, error) {
+	var conflicts []*livekit.SIPConfigConflict
+
+	existingInbound, err := store.ListSIPInboundTrunk(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mergedInbound := upsertByID(existingInbound, bundle.InboundTrunks, func(t *livekit.SIPInboundTrunkInfo) string { return t.SipTrunkId })
+	if err := sip.ValidateTrunks(mergedInbound); err != nil {
+		for _, t := range bundle.InboundTrunks {
+			conflicts = append(conflicts, &livekit.SIPConfigConflict{Id: t.SipTrunkId, Message: err.Error()})
+		}
+	}
+
+	existingRules, err := store.ListSIPDispatchRule(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mergedRules := upsertByID(existingRules, bundle.DispatchRules, func(r *livekit.SIPDispatchRuleInfo) string { return r.SipDispatchRuleId })
+
+	// A dispatch rule that references a trunk ID outside the merged inbound
+	// set would route to nothing; report it the same way an invalid
+	// trunk/number/pin combination is reported.
+	inboundIDs := make(map[string]bool, len(mergedInbound))
+	for _, t := range mergedInbound {
+		inboundIDs[t.SipTrunkId] = true
+	}
+	var unreachable []*livekit.SIPConfigConflict
+	for _, r := range bundle.DispatchRules {
+		for _, trunkID := range r.TrunkIds {
+			if !inboundIDs[trunkID] {
+				unreachable = append(unreachable, &livekit.SIPConfigConflict{
+					Id:      r.SipDispatchRuleId,
+					Message: fmt.Sprintf("dispatch rule references unknown trunk id %q", trunkID),
+				})
+				break
+			}
+		}
+	}
+	if len(unreachable) > 0 {
+		conflicts = append(conflicts, unreachable...)
+	} else if err := sip.ValidateDispatchRules(mergedRules); err != nil {
+		for _, r := range bundle.DispatchRules {
+			conflicts = append(conflicts, &livekit.SIPConfigConflict{Id: r.SipDispatchRuleId, Message: err.Error()})
+		}
+	}
+
+	return conflicts, nil
+}
+
+// upsertByID overlays upserts on top of existing by ID, returning the
+// resulting union - the same merge MergeSIPConfig performs atomically
+// against the store.
+func upsertByID[T any](existing, upserts []T, idOf func(T) string) []T {
+	byID := make(map[string]T, len(existing)+len(upserts))
+	order := make([]string, 0, len(existing)+len(upserts))
+	for _, v := range existing {
+		id := idOf(v)
+		if _, ok := byID[id]; !ok {
+			order = append(order, id)
+		}
+		byID[id] = v
+	}
+	for _, v := range upserts {
+		id := idOf(v)
+		if _, ok := byID[id]; !ok {
+			order = append(order, id)
+		}
+		byID[id] = v
+	}
+	out := make([]T, 0, len(order))
+	for _, id := range order {
+		out = append(out, byID[id])
+	}
+	return out
+}
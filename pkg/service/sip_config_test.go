@@ -0,0 +1,182 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/protocol/livekit"
+)
+
+// fakeSIPStore backs only the read paths dryRunImportSIPConfig uses; every
+// other method returns errNotImplemented if a test exercises it, so an
+// accidental dependency on unimplemented behavior fails loudly. The
+// exceptions are ListSIPTrunk, ListSIPOutboundTrunk and LoadSIPDefconLevel,
+// which return empty results.
+type fakeSIPStore struct {
+	inbound []*livekit.SIPInboundTrunkInfo
+	rules   []*livekit.SIPDispatchRuleInfo
+}
+
+var errNotImplemented = errors.New("fakeSIPStore: not implemented")
+
+func (f *fakeSIPStore) ListSIPTrunk(context.Context) ([]*livekit.SIPTrunkInfo, error) {
+	return nil, nil
+}
+func (f *fakeSIPStore) StoreSIPTrunk(context.Context, *livekit.SIPTrunkInfo) error {
+	return errNotImplemented
+}
+func (f *fakeSIPStore) ValidateAndStoreSIPTrunk(context.Context, *livekit.SIPTrunkInfo) error {
+	return errNotImplemented
+}
+func (f *fakeSIPStore) DeleteSIPTrunk(context.Context, string) error { return errNotImplemented }
+
+func (f *fakeSIPStore) ListSIPInboundTrunk(context.Context) ([]*livekit.SIPInboundTrunkInfo, error) {
+	return f.inbound, nil
+}
+func (f *fakeSIPStore) LoadSIPInboundTrunk(context.Context, string) (*livekit.SIPInboundTrunkInfo, error) {
+	return nil, errNotImplemented
+}
+func (f *fakeSIPStore) StoreSIPInboundTrunk(context.Context, *livekit.SIPInboundTrunkInfo) error {
+	return errNotImplemented
+}
+func (f *fakeSIPStore) ValidateAndStoreSIPInboundTrunk(context.Context, *livekit.SIPInboundTrunkInfo) error {
+	return errNotImplemented
+}
+func (f *fakeSIPStore) UpdateSIPInboundTrunk(context.Context, string, func(*livekit.SIPInboundTrunkInfo) error) (*livekit.SIPInboundTrunkInfo, error) {
+	return nil, errNotImplemented
+}
+
+func (f *fakeSIPStore) ListSIPOutboundTrunk(context.Context) ([]*livekit.SIPOutboundTrunkInfo, error) {
+	return nil, nil
+}
+func (f *fakeSIPStore) LoadSIPOutboundTrunk(context.Context, string) (*livekit.SIPOutboundTrunkInfo, error) {
+	return nil, errNotImplemented
+}
+func (f *fakeSIPStore) StoreSIPOutboundTrunk(context.Context, *livekit.SIPOutboundTrunkInfo) error {
+	return errNotImplemented
+}
+func (f *fakeSIPStore) UpdateSIPOutboundTrunk(context.Context, string, func(*livekit.SIPOutboundTrunkInfo) error) (*livekit.SIPOutboundTrunkInfo, error) {
+	return nil, errNotImplemented
+}
+
+func (f *fakeSIPStore) LoadSIPDefconLevel(context.Context) (int32, error) { return 0, nil }
+func (f *fakeSIPStore) StoreSIPDefconLevel(context.Context, int32) error  { return errNotImplemented }
+
+func (f *fakeSIPStore) StoreSIPTrunkStatus(context.Context, *livekit.SIPTrunkStatus) error {
+	return errNotImplemented
+}
+func (f *fakeSIPStore) LoadSIPTrunkStatus(context.Context, string) (*livekit.SIPTrunkStatus, error) {
+	return nil, errNotImplemented
+}
+func (f *fakeSIPStore) ListSIPTrunkStatus(context.Context) ([]*livekit.SIPTrunkStatus, error) {
+	return nil, errNotImplemented
+}
+
+func (f *fakeSIPStore) ListSIPDispatchRule(context.Context) ([]*livekit.SIPDispatchRuleInfo, error) {
+	return f.rules, nil
+}
+func (f *fakeSIPStore) LoadSIPDispatchRule(context.Context, string) (*livekit.SIPDispatchRuleInfo, error) {
+	return nil, errNotImplemented
+}
+func (f *fakeSIPStore) StoreSIPDispatchRule(context.Context, *livekit.SIPDispatchRuleInfo) error {
+	return errNotImplemented
+}
+func (f *fakeSIPStore) ValidateAndStoreSIPDispatchRule(context.Context, *livekit.SIPDispatchRuleInfo) error {
+	return errNotImplemented
+}
+func (f *fakeSIPStore) UpdateSIPDispatchRule(context.Context, string, func(*livekit.SIPDispatchRuleInfo) error) (*livekit.SIPDispatchRuleInfo, error) {
+	return nil, errNotImplemented
+}
+func (f *fakeSIPStore) DeleteSIPDispatchRule(context.Context, *livekit.SIPDispatchRuleInfo) error {
+	return errNotImplemented
+}
+
+func (f *fakeSIPStore) ReplaceSIPConfig(context.Context, *livekit.SIPConfigBundle) error {
+	return errNotImplemented
+}
+func (f *fakeSIPStore) MergeSIPConfig(context.Context, *livekit.SIPConfigBundle) error {
+	return errNotImplemented
+}
+
+var _ SIPStore = (*fakeSIPStore)(nil)
+
+func TestDryRunImportSIPConfig_UnreachableDispatchRuleTrunkRef(t *testing.T) {
+	store := &fakeSIPStore{
+		inbound: []*livekit.SIPInboundTrunkInfo{{SipTrunkId: "TR_known"}},
+	}
+	bundle := &livekit.SIPConfigBundle{
+		DispatchRules: []*livekit.SIPDispatchRuleInfo{{
+			SipDispatchRuleId: "SDR_new",
+			TrunkIds:          []string{"TR_does_not_exist"},
+		}},
+	}
+	conflicts, err := dryRunImportSIPConfig(context.Background(), store, bundle)
+	require.NoError(t, err)
+	require.Len(t, conflicts, 1)
+	require.Equal(t, "SDR_new", conflicts[0].Id)
+}
+
+func TestDryRunImportSIPConfig_ReachableDispatchRuleTrunkRefNoConflict(t *testing.T) {
+	store := &fakeSIPStore{
+		inbound: []*livekit.SIPInboundTrunkInfo{{SipTrunkId: "TR_known"}},
+	}
+	bundle := &livekit.SIPConfigBundle{
+		DispatchRules: []*livekit.SIPDispatchRuleInfo{{
+			SipDispatchRuleId: "SDR_new",
+			TrunkIds:          []string{"TR_known"},
+		}},
+	}
+	conflicts, err := dryRunImportSIPConfig(context.Background(), store, bundle)
+	require.NoError(t, err)
+	require.Empty(t, conflicts)
+}
+
+// A dispatch rule in the bundle can reference a trunk that's also being
+// imported in the same bundle, not just one that already exists in the
+// store - the merged set, not just existing, must back the reachability
+// check.
+func TestDryRunImportSIPConfig_DispatchRuleCanReferenceTrunkFromSameBundle(t *testing.T) {
+	store := &fakeSIPStore{}
+	bundle := &livekit.SIPConfigBundle{
+		InboundTrunks: []*livekit.SIPInboundTrunkInfo{{SipTrunkId: "TR_new"}},
+		DispatchRules: []*livekit.SIPDispatchRuleInfo{{
+			SipDispatchRuleId: "SDR_new",
+			TrunkIds:          []string{"TR_new"},
+		}},
+	}
+	conflicts, err := dryRunImportSIPConfig(context.Background(), store, bundle)
+	require.NoError(t, err)
+	require.Empty(t, conflicts)
+}
+
+// Re-importing an existing trunk with edits must be treated as an update to
+// that ID (matching MergeSIPConfig's upsert-by-ID semantics), not as a
+// second, duplicate trunk alongside the original.
+func TestDryRunImportSIPConfig_ReimportingExistingTrunkIsAnUpdateNotADuplicate(t *testing.T) {
+	store := &fakeSIPStore{
+		inbound: []*livekit.SIPInboundTrunkInfo{{SipTrunkId: "TR_existing", Name: "old name"}},
+	}
+	bundle := &livekit.SIPConfigBundle{
+		InboundTrunks: []*livekit.SIPInboundTrunkInfo{{SipTrunkId: "TR_existing", Name: "new name"}},
+	}
+	conflicts, err := dryRunImportSIPConfig(context.Background(), store, bundle)
+	require.NoError(t, err)
+	require.Empty(t, conflicts)
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/livekit-server/pkg/config"
+	"github.com/livekit/protocol/livekit"
+)
+
+func TestCheckDefcon_WildcardInboundTrunkRejectedAtRateLimited(t *testing.T) {
+	s := &SIPService{conf: &config.SIPConfig{}}
+	err := s.checkDefconForLevel(context.Background(), SIPDefconRateLimited, sipOpMutateInboundTrunk, &livekit.SIPInboundTrunkInfo{
+		InboundNumbers: []string{"*"},
+	})
+	require.ErrorIs(t, err, ErrSIPWildcardInboundRejected)
+}
+
+func TestCheckDefcon_NonWildcardInboundTrunkAllowedAtRateLimited(t *testing.T) {
+	s := &SIPService{conf: &config.SIPConfig{}}
+	err := s.checkDefconForLevel(context.Background(), SIPDefconRateLimited, sipOpMutateInboundTrunk, &livekit.SIPInboundTrunkInfo{
+		InboundNumbers: []string{"+15550000000"},
+	})
+	require.NoError(t, err)
+}
+
+func TestCheckDefcon_LockdownBlocksEveryMutation(t *testing.T) {
+	s := &SIPService{conf: &config.SIPConfig{}}
+	require.ErrorIs(t, s.checkDefconForLevel(context.Background(), SIPDefconLockdown, sipOpMutateInboundTrunk, nil), ErrSIPLockdown)
+	require.ErrorIs(t, s.checkDefconForLevel(context.Background(), SIPDefconLockdown, sipOpMutateOutboundTrunk, nil), ErrSIPLockdown)
+	require.ErrorIs(t, s.checkDefconForLevel(context.Background(), SIPDefconLockdown, sipOpMutateDispatchRule, nil), ErrSIPLockdown)
+	require.ErrorIs(t, s.checkDefconForLevel(context.Background(), SIPDefconLockdown, sipOpCall, nil), ErrSIPLockdown)
+	require.NoError(t, s.checkDefconForLevel(context.Background(), SIPDefconLockdown, sipOpRead, nil))
+}
+
+// outboundRateLimiter backs the DEFCON-4 outbound call limiter. A single
+// caller's key must always get back the same *rate.Limiter instance, or the
+// limit resets to nothing on every call.
+func TestOutboundRateLimiter_SameKeySharesLimiter(t *testing.T) {
+	s := &SIPService{conf: &config.SIPConfig{DefconOutboundRateLimitInterval: time.Minute, DefconOutboundRateLimitBurst: 1}}
+	a := s.outboundRateLimiter("key-a")
+	b := s.outboundRateLimiter("key-a")
+	require.Same(t, a, b)
+
+	c := s.outboundRateLimiter("key-b")
+	require.NotSame(t, a, c)
+}
+
+// The limiter map must never grow without bound - otherwise a caller able to
+// mint arbitrarily many distinct keys (e.g. by bucketing on a caller-chosen
+// value) could exhaust memory.
+func TestOutboundRateLimiter_MapIsBounded(t *testing.T) {
+	s := &SIPService{conf: &config.SIPConfig{DefconOutboundRateLimitInterval: time.Minute, DefconOutboundRateLimitBurst: 1}}
+	for i := 0; i < sipDefconMaxLimiterKeys+100; i++ {
+		s.outboundRateLimiter(fmt.Sprintf("key-%d", i))
+	}
+	s.defconLimiters.mu.Lock()
+	n := len(s.defconLimiters.byKey)
+	s.defconLimiters.mu.Unlock()
+	require.LessOrEqual(t, n, sipDefconMaxLimiterKeys)
+}
+
+func TestCallerProjectKey_FallsBackToDefaultWithoutGrants(t *testing.T) {
+	require.Equal(t, "default", callerProjectKey(context.Background()))
+}
@@ -0,0 +1,124 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+// This file depends on livekit.SIPTrunkStatus, rpc.ReportTrunkStatusRequest,
+// and the SipTrunkStatus field on livekit.WebhookEvent. None of these exist
+// in the pinned github.com/livekit/protocol version yet - they need to land
+// there first, with this repo's go.mod bumped to the resulting version,
+// before this file builds.
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/protocol/rpc"
+)
+
+// maxTrunkFailuresBeforeDown is the number of consecutive failed probes or
+// missed keepalives after which a trunk is reported DOWN rather than
+// DEGRADED.
+const maxTrunkFailuresBeforeDown = 3
+
+func (s *SIPService) GetSIPTrunkStatus(ctx context.Context, req *livekit.GetSIPTrunkStatusRequest) (*livekit.SIPTrunkStatus, error) {
+	if err := s.ensureSIPAdminPermission(ctx, sipOpRead, nil); err != nil {
+		return nil, err
+	}
+	if s.store == nil {
+		return nil, ErrSIPNotConnected
+	}
+	status, err := s.store.LoadSIPTrunkStatus(ctx, req.SipTrunkId)
+	if err != nil {
+		return nil, err
+	}
+	if status == nil {
+		return &livekit.SIPTrunkStatus{
+			SipTrunkId: req.SipTrunkId,
+			State:      livekit.SIPTrunkStatus_DOWN,
+		}, nil
+	}
+	return status, nil
+}
+
+func (s *SIPService) ListSIPTrunkStatus(ctx context.Context, req *livekit.ListSIPTrunkStatusRequest) (*livekit.ListSIPTrunkStatusResponse, error) {
+	if err := s.ensureSIPAdminPermission(ctx, sipOpRead, nil); err != nil {
+		return nil, err
+	}
+	if s.store == nil {
+		return nil, ErrSIPNotConnected
+	}
+	items, err := s.store.ListSIPTrunkStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &livekit.ListSIPTrunkStatusResponse{Items: items}, nil
+}
+
+// ReportTrunkStatus is called by the SIP worker, via rpc.SIPInternal, with a
+// keepalive/probe sample for a single trunk. It persists the sample and, on
+// a HEALTHY/DEGRADED/DOWN transition, notifies webhook subscribers.
+func (s *SIPService) ReportTrunkStatus(ctx context.Context, req *rpc.ReportTrunkStatusRequest) (*emptypb.Empty, error) {
+	if s.store == nil {
+		return nil, ErrSIPNotConnected
+	}
+	log := logger.GetLogger().WithValues("sipTrunk", req.SipTrunkId)
+
+	prev, err := s.store.LoadSIPTrunkStatus(ctx, req.SipTrunkId)
+	if err != nil {
+		log.Errorw("cannot load previous sip trunk status", err)
+		return nil, err
+	}
+	status := &livekit.SIPTrunkStatus{
+		SipTrunkId:       req.SipTrunkId,
+		RegisterTime:     req.RegisterTime,
+		LastKeepaliveAt:  req.LastKeepaliveAt,
+		TryCount:         req.TryCount,
+		LastResponseCode: req.LastResponseCode,
+		ActiveCalls:      req.ActiveCalls,
+		State:            aggregateTrunkState(req),
+	}
+	if err := s.store.StoreSIPTrunkStatus(ctx, status); err != nil {
+		log.Errorw("cannot store sip trunk status", err)
+		return nil, err
+	}
+	if prev == nil || prev.State != status.State {
+		s.notifyTrunkStatusChanged(ctx, status)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func aggregateTrunkState(req *rpc.ReportTrunkStatusRequest) livekit.SIPTrunkStatus_State {
+	switch {
+	case req.TryCount == 0:
+		return livekit.SIPTrunkStatus_HEALTHY
+	case req.TryCount < maxTrunkFailuresBeforeDown:
+		return livekit.SIPTrunkStatus_DEGRADED
+	default:
+		return livekit.SIPTrunkStatus_DOWN
+	}
+}
+
+func (s *SIPService) notifyTrunkStatusChanged(ctx context.Context, status *livekit.SIPTrunkStatus) {
+	if s.telemetry == nil {
+		return
+	}
+	s.telemetry.NotifyEvent(ctx, &livekit.WebhookEvent{
+		Event:          "sip_trunk_status_changed",
+		SipTrunkStatus: status,
+	})
+}
@@ -0,0 +1,92 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+
+	"github.com/livekit/protocol/livekit"
+)
+
+// SIPStore persists SIP trunks and dispatch rules.
+//
+// The ValidateAndStore* methods run the list/validate/put sequence for a
+// single trunk or rule set as one atomic operation against the backing
+// store, so that two concurrent callers can never both pass validation
+// against a set that is stale by the time either of them writes.
+// Implementations that cannot provide this atomically (e.g. a plain KV put)
+// must still serialize the sequence, e.g. with a per-store mutex.
+type SIPStore interface {
+	ListSIPTrunk(ctx context.Context) ([]*livekit.SIPTrunkInfo, error)
+	// StoreSIPTrunk is deprecated in favor of ValidateAndStoreSIPTrunk.
+	StoreSIPTrunk(ctx context.Context, info *livekit.SIPTrunkInfo) error
+	// ValidateAndStoreSIPTrunk validates info against the full set of existing
+	// trunks and stores it, as a single atomic operation.
+	ValidateAndStoreSIPTrunk(ctx context.Context, info *livekit.SIPTrunkInfo) error
+	DeleteSIPTrunk(ctx context.Context, sipTrunkID string) error
+
+	ListSIPInboundTrunk(ctx context.Context) ([]*livekit.SIPInboundTrunkInfo, error)
+	LoadSIPInboundTrunk(ctx context.Context, sipTrunkID string) (*livekit.SIPInboundTrunkInfo, error)
+	// StoreSIPInboundTrunk is deprecated in favor of ValidateAndStoreSIPInboundTrunk.
+	StoreSIPInboundTrunk(ctx context.Context, info *livekit.SIPInboundTrunkInfo) error
+	// ValidateAndStoreSIPInboundTrunk validates info against the full set of
+	// existing inbound trunks (catching e.g. two trunks claiming the same
+	// InboundNumbers/InboundAddresses) and stores it atomically.
+	ValidateAndStoreSIPInboundTrunk(ctx context.Context, info *livekit.SIPInboundTrunkInfo) error
+	// UpdateSIPInboundTrunk loads the trunk, applies update, re-validates the
+	// full inbound trunk set against the result, and stores it, all as one
+	// atomic operation. update returning an error aborts the whole operation
+	// without storing anything.
+	UpdateSIPInboundTrunk(ctx context.Context, sipTrunkID string, update func(*livekit.SIPInboundTrunkInfo) error) (*livekit.SIPInboundTrunkInfo, error)
+
+	ListSIPOutboundTrunk(ctx context.Context) ([]*livekit.SIPOutboundTrunkInfo, error)
+	LoadSIPOutboundTrunk(ctx context.Context, sipTrunkID string) (*livekit.SIPOutboundTrunkInfo, error)
+	StoreSIPOutboundTrunk(ctx context.Context, info *livekit.SIPOutboundTrunkInfo) error
+	// UpdateSIPOutboundTrunk loads the trunk, applies update, and stores it
+	// atomically.
+	UpdateSIPOutboundTrunk(ctx context.Context, sipTrunkID string, update func(*livekit.SIPOutboundTrunkInfo) error) (*livekit.SIPOutboundTrunkInfo, error)
+
+	// LoadSIPDefconLevel returns the current SIP defcon level, or 0 if one
+	// has never been set (callers should treat 0 as SIPDefconNormal).
+	LoadSIPDefconLevel(ctx context.Context) (int32, error)
+	StoreSIPDefconLevel(ctx context.Context, level int32) error
+
+	// StoreSIPTrunkStatus records the latest health sample reported for a
+	// trunk, overwriting any previous sample for the same SipTrunkId.
+	StoreSIPTrunkStatus(ctx context.Context, status *livekit.SIPTrunkStatus) error
+	LoadSIPTrunkStatus(ctx context.Context, sipTrunkID string) (*livekit.SIPTrunkStatus, error)
+	ListSIPTrunkStatus(ctx context.Context) ([]*livekit.SIPTrunkStatus, error)
+
+	ListSIPDispatchRule(ctx context.Context) ([]*livekit.SIPDispatchRuleInfo, error)
+	LoadSIPDispatchRule(ctx context.Context, sipDispatchRuleID string) (*livekit.SIPDispatchRuleInfo, error)
+	// StoreSIPDispatchRule is deprecated in favor of ValidateAndStoreSIPDispatchRule.
+	StoreSIPDispatchRule(ctx context.Context, info *livekit.SIPDispatchRuleInfo) error
+	// ValidateAndStoreSIPDispatchRule validates info against the full set of
+	// existing dispatch rules and stores it atomically.
+	ValidateAndStoreSIPDispatchRule(ctx context.Context, info *livekit.SIPDispatchRuleInfo) error
+	// UpdateSIPDispatchRule loads the rule, applies update, re-validates the
+	// full dispatch rule set against the result, and stores it atomically.
+	UpdateSIPDispatchRule(ctx context.Context, sipDispatchRuleID string, update func(*livekit.SIPDispatchRuleInfo) error) (*livekit.SIPDispatchRuleInfo, error)
+	DeleteSIPDispatchRule(ctx context.Context, info *livekit.SIPDispatchRuleInfo) error
+
+	// ReplaceSIPConfig atomically discards every existing inbound/outbound
+	// trunk and dispatch rule and stores bundle in their place, validating
+	// the new set first. All-or-nothing: a validation failure leaves the
+	// previous config untouched.
+	ReplaceSIPConfig(ctx context.Context, bundle *livekit.SIPConfigBundle) error
+	// MergeSIPConfig atomically upserts bundle's trunks and dispatch rules by
+	// ID into the existing set, validating the resulting union first.
+	MergeSIPConfig(ctx context.Context, bundle *livekit.SIPConfigBundle) error
+}
@@ -0,0 +1,690 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/sip"
+	"github.com/livekit/protocol/utils"
+	"github.com/livekit/protocol/utils/guid"
+)
+
+const (
+	etcdSIPTrunkPrefix         = "/sip/trunk/"
+	etcdSIPInboundTrunkPrefix  = "/sip/inbound_trunk/"
+	etcdSIPOutboundTrunkPrefix = "/sip/outbound_trunk/"
+	etcdSIPDispatchRulePrefix  = "/sip/dispatch_rule/"
+	etcdSIPTrunkStatusPrefix   = "/sip/trunk_status/"
+	etcdSIPDefconLevelKey      = "/sip/defcon_level"
+
+	// Version keys for each collection. Every transaction that validates a
+	// write against the rest of a collection must stm.Get the collection's
+	// version key (so a concurrent writer that inserts/deletes a key this
+	// transaction never otherwise reads is still detected as a conflict) and
+	// bump it as part of the same write.
+	etcdSIPInboundTrunkVersionKey  = "/sip/version/inbound_trunk"
+	etcdSIPOutboundTrunkVersionKey = "/sip/version/outbound_trunk"
+	etcdSIPDispatchRuleVersionKey  = "/sip/version/dispatch_rule"
+)
+
+// observeAndBumpVersion reads a collection's version key through the STM -
+// registering it as observed, so the transaction conflicts with any other
+// writer to the same collection, including one that only inserts or deletes
+// a key this transaction never individually reads - and writes back an
+// incremented value.
+func observeAndBumpVersion(stm concurrency.STM, key string) {
+	cur := stm.Get(key)
+	n, _ := strconv.ParseInt(cur, 10, 64)
+	stm.Put(key, strconv.FormatInt(n+1, 10))
+}
+
+// EtcdSIPStore stores SIP trunks and dispatch rules in etcd. Writes that must
+// observe the rest of the set (create, update) run inside an STM transaction
+// keyed on the revision of every key they read, so a concurrent writer that
+// changes the set is detected and the transaction is retried rather than
+// silently overwriting a validation decision made against stale data.
+type EtcdSIPStore struct {
+	c *clientv3.Client
+}
+
+func NewEtcdSIPStore(c *clientv3.Client) *EtcdSIPStore {
+	return &EtcdSIPStore{c: c}
+}
+
+func (s *EtcdSIPStore) ListSIPTrunk(ctx context.Context) ([]*livekit.SIPTrunkInfo, error) {
+	resp, err := s.c.Get(ctx, etcdSIPTrunkPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*livekit.SIPTrunkInfo, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		info := &livekit.SIPTrunkInfo{}
+		if err := proto.Unmarshal(kv.Value, info); err != nil {
+			return nil, err
+		}
+		out = append(out, info)
+	}
+	return out, nil
+}
+
+func (s *EtcdSIPStore) StoreSIPTrunk(ctx context.Context, info *livekit.SIPTrunkInfo) error {
+	data, err := proto.Marshal(info)
+	if err != nil {
+		return err
+	}
+	_, err = s.c.Put(ctx, etcdSIPTrunkPrefix+info.SipTrunkId, string(data))
+	return err
+}
+
+func (s *EtcdSIPStore) ValidateAndStoreSIPTrunk(ctx context.Context, info *livekit.SIPTrunkInfo) error {
+	isNew := info.SipTrunkId == ""
+	_, err := concurrency.NewSTM(s.c, func(stm concurrency.STM) error {
+		// SIPTrunkInfo shares its InboundNumbers/InboundAddresses namespace
+		// with SIPInboundTrunkInfo, so validate against that set, same as
+		// the old list-then-validate path did via info.AsInbound().
+		resp, err := s.c.Get(ctx, etcdSIPInboundTrunkPrefix, clientv3.WithPrefix())
+		if err != nil {
+			return err
+		}
+		list := make([]*livekit.SIPInboundTrunkInfo, 0, len(resp.Kvs)+1)
+		for _, kv := range resp.Kvs {
+			// Observe each key through the STM so the transaction conflicts
+			// (and retries) if another writer mutates it before we commit.
+			stm.Get(string(kv.Key))
+			cur := &livekit.SIPInboundTrunkInfo{}
+			if err := proto.Unmarshal(kv.Value, cur); err != nil {
+				return err
+			}
+			list = append(list, cur)
+		}
+		if isNew {
+			// Clear an ID left over from an attempt the STM is retrying.
+			info.SipTrunkId = ""
+		}
+		list = append(list, info.AsInbound())
+		if err := sip.ValidateTrunks(list); err != nil {
+			return err
+		}
+		// Generate the ID only after validation, so a validation error names
+		// the new trunk "<new>" instead of an ID that was never stored.
+		if isNew {
+			info.SipTrunkId = guid.New(utils.SIPTrunkPrefix)
+		}
+		data, err := proto.Marshal(info)
+		if err != nil {
+			return err
+		}
+		stm.Put(etcdSIPTrunkPrefix+info.SipTrunkId, string(data))
+		observeAndBumpVersion(stm, etcdSIPInboundTrunkVersionKey)
+		return nil
+	})
+	return err
+}
+
+func (s *EtcdSIPStore) DeleteSIPTrunk(ctx context.Context, sipTrunkID string) error {
+	_, err := s.c.Delete(ctx, etcdSIPTrunkPrefix+sipTrunkID)
+	return err
+}
+
+func (s *EtcdSIPStore) ListSIPInboundTrunk(ctx context.Context) ([]*livekit.SIPInboundTrunkInfo, error) {
+	resp, err := s.c.Get(ctx, etcdSIPInboundTrunkPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*livekit.SIPInboundTrunkInfo, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		info := &livekit.SIPInboundTrunkInfo{}
+		if err := proto.Unmarshal(kv.Value, info); err != nil {
+			return nil, err
+		}
+		out = append(out, info)
+	}
+	return out, nil
+}
+
+func (s *EtcdSIPStore) LoadSIPInboundTrunk(ctx context.Context, sipTrunkID string) (*livekit.SIPInboundTrunkInfo, error) {
+	resp, err := s.c.Get(ctx, etcdSIPInboundTrunkPrefix+sipTrunkID)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrSIPTrunkNotFound
+	}
+	info := &livekit.SIPInboundTrunkInfo{}
+	if err := proto.Unmarshal(resp.Kvs[0].Value, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (s *EtcdSIPStore) StoreSIPInboundTrunk(ctx context.Context, info *livekit.SIPInboundTrunkInfo) error {
+	data, err := proto.Marshal(info)
+	if err != nil {
+		return err
+	}
+	_, err = s.c.Put(ctx, etcdSIPInboundTrunkPrefix+info.SipTrunkId, string(data))
+	return err
+}
+
+func (s *EtcdSIPStore) ValidateAndStoreSIPInboundTrunk(ctx context.Context, info *livekit.SIPInboundTrunkInfo) error {
+	isNew := info.SipTrunkId == ""
+	_, err := concurrency.NewSTM(s.c, func(stm concurrency.STM) error {
+		resp, err := s.c.Get(ctx, etcdSIPInboundTrunkPrefix, clientv3.WithPrefix())
+		if err != nil {
+			return err
+		}
+		list := make([]*livekit.SIPInboundTrunkInfo, 0, len(resp.Kvs)+1)
+		for _, kv := range resp.Kvs {
+			// Observe each key through the STM so the transaction conflicts
+			// (and retries) if another writer mutates it before we commit.
+			stm.Get(string(kv.Key))
+			cur := &livekit.SIPInboundTrunkInfo{}
+			if err := proto.Unmarshal(kv.Value, cur); err != nil {
+				return err
+			}
+			list = append(list, cur)
+		}
+		if isNew {
+			// Clear an ID left over from an attempt the STM is retrying.
+			info.SipTrunkId = ""
+		}
+		list = append(list, info)
+		if err := sip.ValidateTrunks(list); err != nil {
+			return err
+		}
+		// Generate the ID only after validation, so a validation error names
+		// the new trunk "<new>" instead of an ID that was never stored.
+		if isNew {
+			info.SipTrunkId = guid.New(utils.SIPTrunkPrefix)
+			info.Etag = guid.New(sipEtagPrefix)
+		}
+		data, err := proto.Marshal(info)
+		if err != nil {
+			return err
+		}
+		stm.Put(etcdSIPInboundTrunkPrefix+info.SipTrunkId, string(data))
+		observeAndBumpVersion(stm, etcdSIPInboundTrunkVersionKey)
+		return nil
+	})
+	return err
+}
+
+func (s *EtcdSIPStore) UpdateSIPInboundTrunk(ctx context.Context, sipTrunkID string, update func(*livekit.SIPInboundTrunkInfo) error) (*livekit.SIPInboundTrunkInfo, error) {
+	var out *livekit.SIPInboundTrunkInfo
+	key := etcdSIPInboundTrunkPrefix + sipTrunkID
+	_, err := concurrency.NewSTM(s.c, func(stm concurrency.STM) error {
+		val := stm.Get(key)
+		if val == "" {
+			return ErrSIPTrunkNotFound
+		}
+		cur := &livekit.SIPInboundTrunkInfo{}
+		if err := proto.Unmarshal([]byte(val), cur); err != nil {
+			return err
+		}
+		if err := update(cur); err != nil {
+			return err
+		}
+
+		resp, err := s.c.Get(ctx, etcdSIPInboundTrunkPrefix, clientv3.WithPrefix())
+		if err != nil {
+			return err
+		}
+		list := make([]*livekit.SIPInboundTrunkInfo, 0, len(resp.Kvs))
+		for _, kv := range resp.Kvs {
+			if string(kv.Key) == key {
+				continue
+			}
+			// Observe each key through the STM so the transaction conflicts
+			// (and retries) if another writer mutates it before we commit.
+			stm.Get(string(kv.Key))
+			other := &livekit.SIPInboundTrunkInfo{}
+			if err := proto.Unmarshal(kv.Value, other); err != nil {
+				return err
+			}
+			list = append(list, other)
+		}
+		list = append(list, cur)
+		if err := sip.ValidateTrunks(list); err != nil {
+			return err
+		}
+
+		data, err := proto.Marshal(cur)
+		if err != nil {
+			return err
+		}
+		stm.Put(key, string(data))
+		observeAndBumpVersion(stm, etcdSIPInboundTrunkVersionKey)
+		out = cur
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *EtcdSIPStore) ListSIPOutboundTrunk(ctx context.Context) ([]*livekit.SIPOutboundTrunkInfo, error) {
+	resp, err := s.c.Get(ctx, etcdSIPOutboundTrunkPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*livekit.SIPOutboundTrunkInfo, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		info := &livekit.SIPOutboundTrunkInfo{}
+		if err := proto.Unmarshal(kv.Value, info); err != nil {
+			return nil, err
+		}
+		out = append(out, info)
+	}
+	return out, nil
+}
+
+func (s *EtcdSIPStore) LoadSIPOutboundTrunk(ctx context.Context, sipTrunkID string) (*livekit.SIPOutboundTrunkInfo, error) {
+	resp, err := s.c.Get(ctx, etcdSIPOutboundTrunkPrefix+sipTrunkID)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrSIPTrunkNotFound
+	}
+	info := &livekit.SIPOutboundTrunkInfo{}
+	if err := proto.Unmarshal(resp.Kvs[0].Value, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (s *EtcdSIPStore) StoreSIPOutboundTrunk(ctx context.Context, info *livekit.SIPOutboundTrunkInfo) error {
+	data, err := proto.Marshal(info)
+	if err != nil {
+		return err
+	}
+	_, err = s.c.Put(ctx, etcdSIPOutboundTrunkPrefix+info.SipTrunkId, string(data))
+	return err
+}
+
+func (s *EtcdSIPStore) LoadSIPDefconLevel(ctx context.Context) (int32, error) {
+	resp, err := s.c.Get(ctx, etcdSIPDefconLevelKey)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return 0, nil
+	}
+	level, err := strconv.ParseInt(string(resp.Kvs[0].Value), 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return int32(level), nil
+}
+
+func (s *EtcdSIPStore) StoreSIPDefconLevel(ctx context.Context, level int32) error {
+	_, err := s.c.Put(ctx, etcdSIPDefconLevelKey, strconv.Itoa(int(level)))
+	return err
+}
+
+func (s *EtcdSIPStore) StoreSIPTrunkStatus(ctx context.Context, status *livekit.SIPTrunkStatus) error {
+	data, err := proto.Marshal(status)
+	if err != nil {
+		return err
+	}
+	_, err = s.c.Put(ctx, etcdSIPTrunkStatusPrefix+status.SipTrunkId, string(data))
+	return err
+}
+
+func (s *EtcdSIPStore) LoadSIPTrunkStatus(ctx context.Context, sipTrunkID string) (*livekit.SIPTrunkStatus, error) {
+	resp, err := s.c.Get(ctx, etcdSIPTrunkStatusPrefix+sipTrunkID)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	status := &livekit.SIPTrunkStatus{}
+	if err := proto.Unmarshal(resp.Kvs[0].Value, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (s *EtcdSIPStore) ListSIPTrunkStatus(ctx context.Context) ([]*livekit.SIPTrunkStatus, error) {
+	resp, err := s.c.Get(ctx, etcdSIPTrunkStatusPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*livekit.SIPTrunkStatus, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		status := &livekit.SIPTrunkStatus{}
+		if err := proto.Unmarshal(kv.Value, status); err != nil {
+			return nil, err
+		}
+		out = append(out, status)
+	}
+	return out, nil
+}
+
+func (s *EtcdSIPStore) UpdateSIPOutboundTrunk(ctx context.Context, sipTrunkID string, update func(*livekit.SIPOutboundTrunkInfo) error) (*livekit.SIPOutboundTrunkInfo, error) {
+	var out *livekit.SIPOutboundTrunkInfo
+	key := etcdSIPOutboundTrunkPrefix + sipTrunkID
+	_, err := concurrency.NewSTM(s.c, func(stm concurrency.STM) error {
+		val := stm.Get(key)
+		if val == "" {
+			return ErrSIPTrunkNotFound
+		}
+		cur := &livekit.SIPOutboundTrunkInfo{}
+		if err := proto.Unmarshal([]byte(val), cur); err != nil {
+			return err
+		}
+		if err := update(cur); err != nil {
+			return err
+		}
+		data, err := proto.Marshal(cur)
+		if err != nil {
+			return err
+		}
+		stm.Put(key, string(data))
+		out = cur
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *EtcdSIPStore) ListSIPDispatchRule(ctx context.Context) ([]*livekit.SIPDispatchRuleInfo, error) {
+	resp, err := s.c.Get(ctx, etcdSIPDispatchRulePrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*livekit.SIPDispatchRuleInfo, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		info := &livekit.SIPDispatchRuleInfo{}
+		if err := proto.Unmarshal(kv.Value, info); err != nil {
+			return nil, err
+		}
+		out = append(out, info)
+	}
+	return out, nil
+}
+
+func (s *EtcdSIPStore) LoadSIPDispatchRule(ctx context.Context, sipDispatchRuleID string) (*livekit.SIPDispatchRuleInfo, error) {
+	resp, err := s.c.Get(ctx, etcdSIPDispatchRulePrefix+sipDispatchRuleID)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrSIPDispatchRuleNotFound
+	}
+	info := &livekit.SIPDispatchRuleInfo{}
+	if err := proto.Unmarshal(resp.Kvs[0].Value, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (s *EtcdSIPStore) StoreSIPDispatchRule(ctx context.Context, info *livekit.SIPDispatchRuleInfo) error {
+	data, err := proto.Marshal(info)
+	if err != nil {
+		return err
+	}
+	_, err = s.c.Put(ctx, etcdSIPDispatchRulePrefix+info.SipDispatchRuleId, string(data))
+	return err
+}
+
+func (s *EtcdSIPStore) ValidateAndStoreSIPDispatchRule(ctx context.Context, info *livekit.SIPDispatchRuleInfo) error {
+	isNew := info.SipDispatchRuleId == ""
+	_, err := concurrency.NewSTM(s.c, func(stm concurrency.STM) error {
+		resp, err := s.c.Get(ctx, etcdSIPDispatchRulePrefix, clientv3.WithPrefix())
+		if err != nil {
+			return err
+		}
+		list := make([]*livekit.SIPDispatchRuleInfo, 0, len(resp.Kvs)+1)
+		for _, kv := range resp.Kvs {
+			stm.Get(string(kv.Key))
+			cur := &livekit.SIPDispatchRuleInfo{}
+			if err := proto.Unmarshal(kv.Value, cur); err != nil {
+				return err
+			}
+			list = append(list, cur)
+		}
+		if isNew {
+			// Clear an ID left over from an attempt the STM is retrying.
+			info.SipDispatchRuleId = ""
+		}
+		list = append(list, info)
+		if err := sip.ValidateDispatchRules(list); err != nil {
+			return err
+		}
+		// Generate the ID only after validation, so a validation error names
+		// the new rule "<new>" instead of an ID that was never stored.
+		if isNew {
+			info.SipDispatchRuleId = guid.New(utils.SIPDispatchRulePrefix)
+			info.Etag = guid.New(sipEtagPrefix)
+		}
+		data, err := proto.Marshal(info)
+		if err != nil {
+			return err
+		}
+		stm.Put(etcdSIPDispatchRulePrefix+info.SipDispatchRuleId, string(data))
+		observeAndBumpVersion(stm, etcdSIPDispatchRuleVersionKey)
+		return nil
+	})
+	return err
+}
+
+func (s *EtcdSIPStore) UpdateSIPDispatchRule(ctx context.Context, sipDispatchRuleID string, update func(*livekit.SIPDispatchRuleInfo) error) (*livekit.SIPDispatchRuleInfo, error) {
+	var out *livekit.SIPDispatchRuleInfo
+	key := etcdSIPDispatchRulePrefix + sipDispatchRuleID
+	_, err := concurrency.NewSTM(s.c, func(stm concurrency.STM) error {
+		val := stm.Get(key)
+		if val == "" {
+			return ErrSIPDispatchRuleNotFound
+		}
+		cur := &livekit.SIPDispatchRuleInfo{}
+		if err := proto.Unmarshal([]byte(val), cur); err != nil {
+			return err
+		}
+		if err := update(cur); err != nil {
+			return err
+		}
+
+		resp, err := s.c.Get(ctx, etcdSIPDispatchRulePrefix, clientv3.WithPrefix())
+		if err != nil {
+			return err
+		}
+		list := make([]*livekit.SIPDispatchRuleInfo, 0, len(resp.Kvs))
+		for _, kv := range resp.Kvs {
+			if string(kv.Key) == key {
+				continue
+			}
+			stm.Get(string(kv.Key))
+			other := &livekit.SIPDispatchRuleInfo{}
+			if err := proto.Unmarshal(kv.Value, other); err != nil {
+				return err
+			}
+			list = append(list, other)
+		}
+		list = append(list, cur)
+		if err := sip.ValidateDispatchRules(list); err != nil {
+			return err
+		}
+
+		data, err := proto.Marshal(cur)
+		if err != nil {
+			return err
+		}
+		stm.Put(key, string(data))
+		observeAndBumpVersion(stm, etcdSIPDispatchRuleVersionKey)
+		out = cur
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *EtcdSIPStore) DeleteSIPDispatchRule(ctx context.Context, info *livekit.SIPDispatchRuleInfo) error {
+	_, err := s.c.Delete(ctx, etcdSIPDispatchRulePrefix+info.SipDispatchRuleId)
+	return err
+}
+
+func (s *EtcdSIPStore) ReplaceSIPConfig(ctx context.Context, bundle *livekit.SIPConfigBundle) error {
+	if err := sip.ValidateTrunks(bundle.InboundTrunks); err != nil {
+		return err
+	}
+	if err := sip.ValidateDispatchRules(bundle.DispatchRules); err != nil {
+		return err
+	}
+	_, err := concurrency.NewSTM(s.c, func(stm concurrency.STM) error {
+		for _, prefix := range []string{etcdSIPInboundTrunkPrefix, etcdSIPOutboundTrunkPrefix, etcdSIPDispatchRulePrefix} {
+			resp, err := s.c.Get(ctx, prefix, clientv3.WithPrefix())
+			if err != nil {
+				return err
+			}
+			for _, kv := range resp.Kvs {
+				stm.Del(string(kv.Key))
+			}
+		}
+		for _, t := range bundle.InboundTrunks {
+			data, err := proto.Marshal(t)
+			if err != nil {
+				return err
+			}
+			stm.Put(etcdSIPInboundTrunkPrefix+t.SipTrunkId, string(data))
+		}
+		for _, t := range bundle.OutboundTrunks {
+			data, err := proto.Marshal(t)
+			if err != nil {
+				return err
+			}
+			stm.Put(etcdSIPOutboundTrunkPrefix+t.SipTrunkId, string(data))
+		}
+		for _, r := range bundle.DispatchRules {
+			data, err := proto.Marshal(r)
+			if err != nil {
+				return err
+			}
+			stm.Put(etcdSIPDispatchRulePrefix+r.SipDispatchRuleId, string(data))
+		}
+		observeAndBumpVersion(stm, etcdSIPInboundTrunkVersionKey)
+		observeAndBumpVersion(stm, etcdSIPOutboundTrunkVersionKey)
+		observeAndBumpVersion(stm, etcdSIPDispatchRuleVersionKey)
+		return nil
+	})
+	return err
+}
+
+func (s *EtcdSIPStore) MergeSIPConfig(ctx context.Context, bundle *livekit.SIPConfigBundle) error {
+	_, err := concurrency.NewSTM(s.c, func(stm concurrency.STM) error {
+		inbound, err := mergeByID(ctx, s.c, stm, etcdSIPInboundTrunkPrefix, etcdSIPInboundTrunkVersionKey, bundle.InboundTrunks,
+			func() *livekit.SIPInboundTrunkInfo { return &livekit.SIPInboundTrunkInfo{} },
+			func(t *livekit.SIPInboundTrunkInfo) string { return t.SipTrunkId },
+		)
+		if err != nil {
+			return err
+		}
+		if err := sip.ValidateTrunks(inbound); err != nil {
+			return err
+		}
+		outbound, err := mergeByID(ctx, s.c, stm, etcdSIPOutboundTrunkPrefix, etcdSIPOutboundTrunkVersionKey, bundle.OutboundTrunks,
+			func() *livekit.SIPOutboundTrunkInfo { return &livekit.SIPOutboundTrunkInfo{} },
+			func(t *livekit.SIPOutboundTrunkInfo) string { return t.SipTrunkId },
+		)
+		if err != nil {
+			return err
+		}
+		rules, err := mergeByID(ctx, s.c, stm, etcdSIPDispatchRulePrefix, etcdSIPDispatchRuleVersionKey, bundle.DispatchRules,
+			func() *livekit.SIPDispatchRuleInfo { return &livekit.SIPDispatchRuleInfo{} },
+			func(r *livekit.SIPDispatchRuleInfo) string { return r.SipDispatchRuleId },
+		)
+		if err != nil {
+			return err
+		}
+		if err := sip.ValidateDispatchRules(rules); err != nil {
+			return err
+		}
+		for _, t := range bundle.InboundTrunks {
+			data, err := proto.Marshal(t)
+			if err != nil {
+				return err
+			}
+			stm.Put(etcdSIPInboundTrunkPrefix+t.SipTrunkId, string(data))
+		}
+		for _, t := range bundle.OutboundTrunks {
+			data, err := proto.Marshal(t)
+			if err != nil {
+				return err
+			}
+			stm.Put(etcdSIPOutboundTrunkPrefix+t.SipTrunkId, string(data))
+		}
+		for _, r := range bundle.DispatchRules {
+			data, err := proto.Marshal(r)
+			if err != nil {
+				return err
+			}
+			stm.Put(etcdSIPDispatchRulePrefix+r.SipDispatchRuleId, string(data))
+		}
+		observeAndBumpVersion(stm, etcdSIPInboundTrunkVersionKey)
+		observeAndBumpVersion(stm, etcdSIPOutboundTrunkVersionKey)
+		observeAndBumpVersion(stm, etcdSIPDispatchRuleVersionKey)
+		return nil
+	})
+	return err
+}
+
+// mergeByID loads every existing value under prefix, overlays upserts on top
+// by ID, and returns the resulting union for validation. The collection's
+// version key is read through the STM (in addition to each existing key it
+// touches), so a concurrent insert or delete that this snapshot never sees
+// directly still conflicts this transaction via the version bump.
+func mergeByID[T proto.Message](ctx context.Context, c *clientv3.Client, stm concurrency.STM, prefix, versionKey string, upserts []T, newT func() T, idOf func(T) string) ([]T, error) {
+	stm.Get(versionKey)
+	resp, err := c.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]T, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		stm.Get(string(kv.Key))
+		v := newT()
+		if err := proto.Unmarshal(kv.Value, v); err != nil {
+			return nil, err
+		}
+		byID[idOf(v)] = v
+	}
+	for _, u := range upserts {
+		byID[idOf(u)] = u
+	}
+	out := make([]T, 0, len(byID))
+	for _, v := range byID {
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+var (
+	ErrSIPTrunkNotFound        = fmt.Errorf("sip trunk not found")
+	ErrSIPDispatchRuleNotFound = fmt.Errorf("sip dispatch rule not found")
+)
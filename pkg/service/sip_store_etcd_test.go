@@ -0,0 +1,65 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/tests/v3/integration"
+
+	"github.com/livekit/protocol/livekit"
+)
+
+// TestValidateAndStoreSIPInboundTrunk_ConcurrentCreates exercises the exact
+// race ValidateAndStoreSIPInboundTrunk exists to close: two trunks created
+// concurrently that both claim the same InboundNumbers must not both
+// validate successfully against a stale snapshot of the trunk set.
+func TestValidateAndStoreSIPInboundTrunk_ConcurrentCreates(t *testing.T) {
+	integration.BeforeTest(t)
+	clus := integration.NewCluster(t, &integration.ClusterConfig{Size: 1})
+	defer clus.Terminate(t)
+
+	store := NewEtcdSIPStore(clus.Client(0))
+
+	const n = 2
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = store.ValidateAndStoreSIPInboundTrunk(context.Background(), &livekit.SIPInboundTrunkInfo{
+				Name:           "trunk",
+				InboundNumbers: []string{"+15550000000"},
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	var ok int
+	for _, err := range errs {
+		if err == nil {
+			ok++
+		}
+	}
+	require.Equal(t, 1, ok, "exactly one of two concurrent creates claiming the same InboundNumbers should succeed")
+
+	trunks, err := store.ListSIPInboundTrunk(context.Background())
+	require.NoError(t, err)
+	require.Len(t, trunks, 1)
+}
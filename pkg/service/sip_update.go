@@ -0,0 +1,144 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+// This file depends on the Etag field on SIPInboundTrunkInfo/
+// SIPOutboundTrunkInfo/SIPDispatchRuleInfo and the Etag/UpdateMask fields on
+// the corresponding Update*Request types. None of these exist in the pinned
+// github.com/livekit/protocol version yet - they need to land there first,
+// with this repo's go.mod bumped to the resulting version, before this file
+// builds.
+
+import (
+	"context"
+	"errors"
+
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/utils/guid"
+)
+
+const sipEtagPrefix = "ET_"
+
+var ErrSIPEtagMismatch = errors.New("sip: etag does not match the stored trunk/rule - reload and retry")
+
+func (s *SIPService) UpdateSIPInboundTrunk(ctx context.Context, req *livekit.UpdateSIPInboundTrunkRequest) (*livekit.SIPInboundTrunkInfo, error) {
+	if s.store == nil {
+		return nil, ErrSIPNotConnected
+	}
+	if err := s.ensureSIPAdminPermission(ctx, sipOpMutateInboundTrunk, req.Trunk); err != nil {
+		return nil, err
+	}
+	return s.store.UpdateSIPInboundTrunk(ctx, req.SipTrunkId, func(cur *livekit.SIPInboundTrunkInfo) error {
+		if req.Etag != "" && cur.Etag != req.Etag {
+			return ErrSIPEtagMismatch
+		}
+		applySIPInboundTrunkUpdate(cur, req.Trunk, req.UpdateMask.GetPaths())
+		cur.Etag = guid.New(sipEtagPrefix)
+		return nil
+	})
+}
+
+func (s *SIPService) UpdateSIPOutboundTrunk(ctx context.Context, req *livekit.UpdateSIPOutboundTrunkRequest) (*livekit.SIPOutboundTrunkInfo, error) {
+	if s.store == nil {
+		return nil, ErrSIPNotConnected
+	}
+	if err := s.ensureSIPAdminPermission(ctx, sipOpMutateOutboundTrunk, req.Trunk); err != nil {
+		return nil, err
+	}
+	return s.store.UpdateSIPOutboundTrunk(ctx, req.SipTrunkId, func(cur *livekit.SIPOutboundTrunkInfo) error {
+		if req.Etag != "" && cur.Etag != req.Etag {
+			return ErrSIPEtagMismatch
+		}
+		applySIPOutboundTrunkUpdate(cur, req.Trunk, req.UpdateMask.GetPaths())
+		cur.Etag = guid.New(sipEtagPrefix)
+		return nil
+	})
+}
+
+func (s *SIPService) UpdateSIPDispatchRule(ctx context.Context, req *livekit.UpdateSIPDispatchRuleRequest) (*livekit.SIPDispatchRuleInfo, error) {
+	if s.store == nil {
+		return nil, ErrSIPNotConnected
+	}
+	if err := s.ensureSIPAdminPermission(ctx, sipOpMutateDispatchRule, nil); err != nil {
+		return nil, err
+	}
+	return s.store.UpdateSIPDispatchRule(ctx, req.SipDispatchRuleId, func(cur *livekit.SIPDispatchRuleInfo) error {
+		if req.Etag != "" && cur.Etag != req.Etag {
+			return ErrSIPEtagMismatch
+		}
+		applySIPDispatchRuleUpdate(cur, req.Rule, req.UpdateMask.GetPaths())
+		cur.Etag = guid.New(sipEtagPrefix)
+		return nil
+	})
+}
+
+func applySIPInboundTrunkUpdate(cur, upd *livekit.SIPInboundTrunkInfo, paths []string) {
+	for _, path := range paths {
+		switch path {
+		case "name":
+			cur.Name = upd.Name
+		case "metadata":
+			cur.Metadata = upd.Metadata
+		case "inbound_numbers":
+			cur.InboundNumbers = upd.InboundNumbers
+		case "inbound_addresses":
+			cur.InboundAddresses = upd.InboundAddresses
+		case "inbound_username":
+			cur.InboundUsername = upd.InboundUsername
+		case "inbound_password":
+			cur.InboundPassword = upd.InboundPassword
+		}
+	}
+}
+
+func applySIPOutboundTrunkUpdate(cur, upd *livekit.SIPOutboundTrunkInfo, paths []string) {
+	for _, path := range paths {
+		switch path {
+		case "name":
+			cur.Name = upd.Name
+		case "metadata":
+			cur.Metadata = upd.Metadata
+		case "outbound_address":
+			cur.OutboundAddress = upd.OutboundAddress
+		case "outbound_number":
+			cur.OutboundNumber = upd.OutboundNumber
+		case "outbound_username":
+			cur.OutboundUsername = upd.OutboundUsername
+		case "outbound_password":
+			cur.OutboundPassword = upd.OutboundPassword
+		}
+	}
+}
+
+func applySIPDispatchRuleUpdate(cur, upd *livekit.SIPDispatchRuleInfo, paths []string) {
+	for _, path := range paths {
+		switch path {
+		case "name":
+			cur.Name = upd.Name
+		case "metadata":
+			cur.Metadata = upd.Metadata
+		case "rule":
+			cur.Rule = upd.Rule
+		case "trunk_ids":
+			cur.TrunkIds = upd.TrunkIds
+		case "inbound_numbers":
+			cur.InboundNumbers = upd.InboundNumbers
+		case "hide_phone_number":
+			cur.HidePhoneNumber = upd.HidePhoneNumber
+		case "attributes":
+			cur.Attributes = upd.Attributes
+		}
+	}
+}